@@ -0,0 +1,147 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/marapongo/mu/sdk/go/pkg/murpc"
+)
+
+// pluginBrokerAddrKey is the environment variable a plugin's Broker reads to find the host's broker listener.
+const pluginBrokerAddrKey = "MU_PLUGIN_BROKER_ADDR"
+
+// Broker is the host side of the gRPC broker that lets a resource plugin open additional, service-specific
+// connections back into the host -- e.g. to fetch configuration/secrets, stream progress events, or resolve a
+// dependent resource's outputs -- without the host needing a new top-level RPC on ResourceProvider for each one.
+// It listens locally, dispatches incoming StartStream calls to whatever service the Context has registered under
+// the requested name, and serves that single service on a freshly minted sub-connection.  When the owning Plugin
+// was created with WithTLS, the broker's listener and every sub-connection it hands out require the same
+// mTLS-authenticated transport as the primary ResourceProvider connection -- this back-channel reaches the same
+// sensitive host services (config/secret resolution) that WithTLS exists to protect.
+type Broker struct {
+	ctx         *Context
+	listener    net.Listener
+	server      *grpc.Server
+	tlsMaterial *pluginTLSMaterial
+
+	mu      sync.Mutex
+	streams map[uint64]*brokerStream
+}
+
+// brokerStream is a single sub-connection handed out to a plugin in response to StartStream, kept around for the
+// lifetime of the Broker so that a repeated StartStream for the same stream id reuses it instead of leaking a new
+// listener and goroutine every time.
+type brokerStream struct {
+	listener net.Listener
+	server   *grpc.Server
+}
+
+// newBroker starts listening locally for StartStream calls from a plugin and returns the Broker handle to plumb
+// into the Plugin struct, along with the address to hand the plugin via its process environment.  If tlsMaterial is
+// non-nil, the broker's listener -- and every sub-connection it subsequently hands out via StartStream -- requires
+// mTLS using that material, matching the primary connection's transport security.
+func newBroker(ctx *Context, tlsMaterial *pluginTLSMaterial) (*Broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	var serverOpts []grpc.ServerOption
+	if tlsMaterial != nil {
+		tlsConfig, err := tlsMaterial.brokerServerTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	b := &Broker{
+		ctx:         ctx,
+		listener:    listener,
+		server:      grpc.NewServer(serverOpts...),
+		tlsMaterial: tlsMaterial,
+		streams:     make(map[uint64]*brokerStream),
+	}
+	murpc.RegisterBrokerServer(b.server, b)
+	go b.server.Serve(listener)
+
+	registerBroker(ctx)
+	return b, nil
+}
+
+// Addr returns the address a plugin should dial to reach this Broker, for inclusion in the child's environment.
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Close tears down the broker's listener and every sub-connection it has handed out, and releases this Broker's
+// share of the services registered against its Context -- since a Context is shared by every Plugin created
+// against it, this only drops the Context's entry in hostServices once every sibling Broker has also closed.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	for id, stream := range b.streams {
+		stream.server.Stop()
+		delete(b.streams, id)
+	}
+	b.mu.Unlock()
+
+	b.server.Stop()
+	unregisterBroker(b.ctx)
+	return nil
+}
+
+// StartStream implements murpc.BrokerServer.  It looks up the service the plugin asked for by name -- one
+// previously registered on this Broker's Context via RegisterService -- and spins up a dedicated sub-connection
+// serving just that service, returning its address so the plugin can dial it directly.  A repeated StartStream for
+// a stream id that's already been started returns the existing sub-connection's address rather than minting
+// another one.  The sub-connection requires the same mTLS transport as the broker's own listener.
+func (b *Broker) StartStream(ctx context.Context, req *murpc.StartStreamRequest) (*murpc.StartStreamResponse, error) {
+	b.mu.Lock()
+	if stream, ok := b.streams[req.Id]; ok {
+		b.mu.Unlock()
+		return &murpc.StartStreamResponse{Addr: stream.listener.Addr().String()}, nil
+	}
+	b.mu.Unlock()
+
+	svc, ok := b.ctx.service(req.ServiceName)
+	if !ok {
+		return nil, fmt.Errorf("no host service registered under the name %q", req.ServiceName)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	var serverOpts []grpc.ServerOption
+	if b.tlsMaterial != nil {
+		tlsConfig, err := b.tlsMaterial.brokerServerTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(serverOpts...)
+	svc.Register(server)
+	go server.Serve(listener)
+
+	b.mu.Lock()
+	if stream, ok := b.streams[req.Id]; ok {
+		// A concurrent StartStream for the same id got there first; keep its sub-connection and drop ours.
+		b.mu.Unlock()
+		server.Stop()
+		return &murpc.StartStreamResponse{Addr: stream.listener.Addr().String()}, nil
+	}
+	b.streams[req.Id] = &brokerStream{listener: listener, server: server}
+	b.mu.Unlock()
+
+	return &murpc.StartStreamResponse{Addr: listener.Addr().String()}, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// HostService is the contract a host-side service -- e.g. a ConfigProvider or LogSink -- must implement to be
+// registered with RegisterService and handed to a resource plugin over its Broker.  Register is called with the
+// freshly minted sub-connection's gRPC server so the service can register its own generated server implementation
+// against it.
+type HostService interface {
+	Register(*grpc.Server)
+}
+
+// ctxServices is the set of host-side services registered against a single Context, plus a count of how many
+// Brokers -- one per still-open Plugin sharing that Context -- are currently relying on them.
+type ctxServices struct {
+	services map[string]HostService
+	brokers  int
+}
+
+// hostServices tracks the host-side services that a Context has made available for resource plugins to dial back
+// into over their Broker.  It is keyed off of the owning Context so that RegisterService doesn't require a change
+// to the Context type itself.  Because a single Context is shared by every Plugin (and therefore every Broker)
+// created against it, entries are reference-counted by registerBroker/unregisterBroker rather than dropped the
+// moment any one Broker closes -- otherwise the first plugin to exit would wipe services still in use by its
+// still-running siblings.
+var hostServices = struct {
+	mu    sync.Mutex
+	byCtx map[*Context]*ctxServices
+}{byCtx: make(map[*Context]*ctxServices)}
+
+// entry returns ctx's ctxServices, creating it if this is the first thing registered or counted against ctx.
+// Callers must hold hostServices.mu.
+func (ctx *Context) entry() *ctxServices {
+	e, ok := hostServices.byCtx[ctx]
+	if !ok {
+		e = &ctxServices{services: make(map[string]HostService)}
+		hostServices.byCtx[ctx] = e
+	}
+	return e
+}
+
+// RegisterService makes a host-side service available under the given name (e.g. "ConfigProvider" or "LogSink")
+// for resource plugins to dial back into via their Broker.  Safe to call concurrently, and safe to call again for
+// the same name to replace a previously registered service.
+func (ctx *Context) RegisterService(name string, svc HostService) {
+	hostServices.mu.Lock()
+	defer hostServices.mu.Unlock()
+	ctx.entry().services[name] = svc
+}
+
+// service looks up a previously registered host-side service by name.
+func (ctx *Context) service(name string) (HostService, bool) {
+	hostServices.mu.Lock()
+	defer hostServices.mu.Unlock()
+	e, ok := hostServices.byCtx[ctx]
+	if !ok {
+		return nil, false
+	}
+	svc, ok := e.services[name]
+	return svc, ok
+}
+
+// registerBroker records that a new Broker is sharing ctx's registered services, so that unregisterBroker won't
+// drop them out from under sibling Brokers/plugins still using the same Context.  Called once from newBroker.
+func registerBroker(ctx *Context) {
+	hostServices.mu.Lock()
+	defer hostServices.mu.Unlock()
+	ctx.entry().brokers++
+}
+
+// unregisterBroker releases this Broker's share of ctx's registered services, dropping ctx's entry from
+// hostServices entirely only once every Broker sharing it -- i.e. every Plugin created against ctx -- has closed.
+func unregisterBroker(ctx *Context) {
+	hostServices.mu.Lock()
+	defer hostServices.mu.Unlock()
+	e, ok := hostServices.byCtx[ctx]
+	if !ok {
+		return
+	}
+	e.brokers--
+	if e.brokers <= 0 {
+		delete(hostServices.byCtx, ctx)
+	}
+}
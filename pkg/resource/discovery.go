@@ -0,0 +1,175 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/golang/glog"
+
+	"github.com/marapongo/mu/pkg/tokens"
+	"github.com/marapongo/mu/pkg/workspace"
+)
+
+// exeSuffix is appended to plugin binary names on platforms that require it.
+var exeSuffix = map[string]string{"windows": ".exe"}[runtime.GOOS]
+
+// PluginDiscovery locates a resource plugin binary on disk across a number of well-known locations, optionally
+// constrained to a semver range taken from the workspace manifest, and verifies an accompanying .sha256 sidecar
+// before permitting anything to run.  Binaries are expected to be named "mu-ressrv-<pkg>[_vX.Y.Z][.exe]"; the
+// qualified package name's "/"s are replaced with "_"s, matching the convention NewPlugin has always used.
+type PluginDiscovery struct {
+	Pkg        tokens.Package
+	Constraint string // an optional semver range, e.g. ">=1.2.0 <2.0.0"; "" matches any version.
+}
+
+// candidate is a single plugin binary PluginDiscovery found while searching.
+type candidate struct {
+	path    string
+	version *semver.Version // nil if the binary name carries no _vX.Y.Z suffix.
+}
+
+// DiscoveryError is returned when no plugin binary satisfying the discovery criteria could be found.  It lists
+// every location that was searched, so a user can tell whether the plugin is missing entirely or just
+// mis-versioned.
+type DiscoveryError struct {
+	Pkg      tokens.Package
+	Searched []string
+}
+
+func (e *DiscoveryError) Error() string {
+	return fmt.Sprintf("no resource provider plugin found for package '%v' (searched: %v)",
+		e.Pkg, strings.Join(e.Searched, ", "))
+}
+
+// searchPaths enumerates the well-known locations PluginDiscovery globs for plugin binaries, in priority order.
+func (d *PluginDiscovery) searchPaths() []string {
+	var paths []string
+	if cwd, err := os.Getwd(); err == nil {
+		paths = append(paths, cwd)
+	}
+	if mpp := os.Getenv("MU_PLUGIN_PATH"); mpp != "" {
+		paths = append(paths, filepath.SplitList(mpp)...)
+	}
+	paths = append(paths, filepath.Join(workspace.InstallRoot(), workspace.InstallRootLibdir, string(d.Pkg)))
+	if u, err := user.Current(); err == nil {
+		paths = append(paths, filepath.Join(u.HomeDir, ".mu", "plugins"))
+	}
+	return paths
+}
+
+// Find searches all of PluginDiscovery's well-known locations for a plugin binary matching Pkg, picks the highest
+// version satisfying Constraint (if any), verifies its .sha256 sidecar, and returns its path.
+func (d *PluginDiscovery) Find() (string, error) {
+	base := pluginPrefix + "-" + strings.Replace(string(d.Pkg), tokens.QNameDelimiter, "_", -1)
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `(?:_v(\d+\.\d+\.\d+))?` + regexp.QuoteMeta(exeSuffix) + `$`)
+
+	var candidates []candidate
+	var searched []string
+	for _, dir := range d.searchPaths() {
+		searched = append(searched, dir)
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			m := pattern.FindStringSubmatch(entry.Name())
+			if m == nil {
+				continue
+			}
+			c := candidate{path: filepath.Join(dir, entry.Name())}
+			if m[1] != "" {
+				if v, err := semver.Parse(m[1]); err == nil {
+					c.version = &v
+				}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	if d.Constraint != "" {
+		rng, err := semver.ParseRange(d.Constraint)
+		if err != nil {
+			return "", fmt.Errorf("invalid version constraint %q for package '%v': %v", d.Constraint, d.Pkg, err)
+		}
+		var filtered []candidate
+		for _, c := range candidates {
+			if c.version != nil && rng(*c.version) {
+				filtered = append(filtered, c)
+			}
+		}
+		candidates = filtered
+	}
+
+	if len(candidates) == 0 {
+		return "", &DiscoveryError{Pkg: d.Pkg, Searched: searched}
+	}
+
+	// An unversioned candidate (no _vX.Y.Z suffix) always ranks below a versioned one, so a binary that carries
+	// version information is never shadowed by one that doesn't; ties among unversioned candidates are arbitrary
+	// since there's nothing to compare.
+	sort.Slice(candidates, func(i, j int) bool {
+		vi, vj := candidates[i].version, candidates[j].version
+		switch {
+		case vi == nil && vj == nil:
+			return false
+		case vi == nil:
+			return true
+		case vj == nil:
+			return false
+		default:
+			return vi.LT(*vj)
+		}
+	})
+	best := candidates[len(candidates)-1]
+
+	if err := verifyPluginChecksum(best.path); err != nil {
+		return "", err
+	}
+	return best.path, nil
+}
+
+// verifyPluginChecksum checks path against an accompanying path+".sha256" sidecar file, refusing to launch the
+// plugin if the checksum doesn't match.  Most plugin binaries in the wild today don't ship a sidecar at all, so a
+// missing one is treated as "nothing to verify" rather than a hard failure; only an actual mismatch refuses launch.
+func verifyPluginChecksum(path string) error {
+	wantRaw, err := ioutil.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		glog.V(5).Infof("no .sha256 checksum sidecar found for plugin binary '%v'; skipping verification", path)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading .sha256 checksum sidecar for plugin binary '%v': %v", path, err)
+	}
+	fields := strings.Fields(string(wantRaw))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty .sha256 checksum sidecar for plugin binary '%v'", path)
+	}
+	want := fields[0]
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for plugin binary '%v': expected %v, got %v", path, want, got)
+	}
+	return nil
+}
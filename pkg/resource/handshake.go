@@ -0,0 +1,100 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pluginMagicCookieKey is the name of an environment variable we set on every plugin child process before exec'ing
+// it.  A well-behaved plugin calls sdk/go/pkg/murpc.VerifyMagicCookie on startup and refuses to run if this value
+// is missing or incorrect.  This is a cheap safety net against some random executable being launched in place of
+// an actual resource provider and having whatever it happens to write to stdout misinterpreted as a handshake line.
+const pluginMagicCookieKey = "MU_PLUGIN_MAGIC_COOKIE"
+const pluginMagicCookieValue = "f68ea9c6-2a1f-4e95-b9fc-17a2e1c7db5a"
+
+// pluginProtocolVersion identifies a version of the handshake/RPC protocol spoken between the host and a resource
+// provider plugin.  Bumping this lets us evolve the wire format -- e.g. add new RPCs -- without silently breaking
+// providers built against an older version of the host.
+type pluginProtocolVersion int
+
+const pluginProtocolVersion1 pluginProtocolVersion = 1
+
+// supportedProtocolVersions enumerates the protocol versions this host knows how to speak.  NewPlugin refuses to
+// proceed if a plugin's handshake advertises a version that isn't in this list.
+var supportedProtocolVersions = []pluginProtocolVersion{pluginProtocolVersion1}
+
+// pluginHandshake is the parsed form of the single line a well-behaved plugin writes to stdout on startup:
+//
+//	CORE-VERSION|APP-VERSION|NETWORK|ADDR|PROTOCOL[|SERVER-CERT]
+//
+// e.g. "1|1|tcp|127.0.0.1:34567|grpc".  This is modeled on the handshake protocol used by HashiCorp's go-plugin.
+// The trailing SERVER-CERT field is optional and only present when the plugin configured its gRPC server with the
+// TLS material the host handed it via env vars (see plugin_tls.go); its presence tells the host it's safe to dial
+// the plugin with mTLS instead of falling back to an insecure connection.
+type pluginHandshake struct {
+	CoreVersion pluginProtocolVersion
+	AppVersion  int
+	Network     string
+	Addr        string
+	Protocol    string
+	ServerCert  string
+}
+
+// HandshakeError indicates that a plugin's handshake line could not be parsed, or that it advertised a protocol
+// version that this host doesn't know how to speak.
+type HandshakeError struct {
+	Line   string
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("invalid plugin handshake %q: %v", e.Line, e.Reason)
+}
+
+// parseHandshake parses a single handshake line written by a plugin to stdout, validating that the advertised
+// protocol version is one this host supports.
+func parseHandshake(line string) (*pluginHandshake, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, &HandshakeError{line, fmt.Sprintf("expected 5 or 6 '|'-delimited fields, got %v", len(parts))}
+	}
+
+	core, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, &HandshakeError{line, fmt.Sprintf("non-numeric core version %q", parts[0])}
+	}
+	app, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, &HandshakeError{line, fmt.Sprintf("non-numeric app version %q", parts[1])}
+	}
+
+	hs := &pluginHandshake{
+		CoreVersion: pluginProtocolVersion(core),
+		AppVersion:  app,
+		Network:     parts[2],
+		Addr:        parts[3],
+		Protocol:    parts[4],
+	}
+
+	var supported bool
+	for _, v := range supportedProtocolVersions {
+		if hs.CoreVersion == v {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, &HandshakeError{
+			line, fmt.Sprintf("unsupported protocol version %v (supported: %v)", core, supportedProtocolVersions),
+		}
+	}
+
+	if len(parts) == 6 {
+		hs.ServerCert = parts[5]
+	}
+
+	return hs, nil
+}
@@ -9,17 +9,17 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strconv"
-	"strings"
+	"time"
+
+	"golang.org/x/net/context"
 
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/marapongo/mu/pkg/diag"
 	"github.com/marapongo/mu/pkg/tokens"
 	"github.com/marapongo/mu/pkg/util/contract"
-	"github.com/marapongo/mu/pkg/workspace"
 	"github.com/marapongo/mu/sdk/go/pkg/murpc"
 )
 
@@ -27,44 +27,71 @@ const pluginPrefix = "mu-ressrv"
 
 // Plugin reflects a resource plugin, loaded dynamically for a single package.
 type Plugin struct {
-	ctx    *Context
-	pkg    tokens.Package
-	proc   *os.Process
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
-	stderr io.ReadCloser
-	conn   *grpc.ClientConn
-	client murpc.ResourceProviderClient
+	ctx             *Context
+	pkg             tokens.Package
+	proc            *os.Process
+	stdin           io.WriteCloser
+	stdout          io.ReadCloser
+	stderr          io.ReadCloser
+	conn            *grpc.ClientConn
+	client          murpc.ResourceProviderClient
+	ProtocolVersion int
+	Broker          *Broker
+	gracePeriod     time.Duration
+	reattached      bool
 }
 
 // NewPlugin attempts to bind to a given package's resource plugin and then creates a gRPC connection to it.  If the
 // plugin could not be found, or an error occurs while creating the child process, an error is returned.
-func NewPlugin(ctx *Context, pkg tokens.Package) (*Plugin, error) {
-	var proc *os.Process
-	var procin io.WriteCloser
-	var procout io.ReadCloser
-	var procerr io.ReadCloser
-
-	// To load a plugin, we first attempt using a well-known name "mu-ressrv-<pkg>".  Note that because <pkg> is a
-	// qualified name, it could contain "/" characters which would obviously cause problems; so we substitute "_"s.
-	// TODO: on Windows, I suppose we will need to append a ".EXE".
-	var err error
-	srvexe := pluginPrefix + "-" + strings.Replace(string(pkg), tokens.QNameDelimiter, "_", -1)
-	if proc, procin, procout, procerr, err = execPlugin(srvexe); err != nil {
-		// If this fails, we will explicitly look in the workspace library, to see if this library has been installed.
-		if execerr, isexecerr := err.(*exec.Error); isexecerr && execerr.Err == exec.ErrNotFound {
-			libexe := filepath.Join(workspace.InstallRoot(), workspace.InstallRootLibdir, string(pkg), srvexe)
-			if proc, procin, procout, procerr, err = execPlugin(libexe); err != nil {
-				return nil, err
-			}
-		} else {
+func NewPlugin(ctx *Context, pkg tokens.Package, opts ...PluginOption) (*Plugin, error) {
+	var options pluginOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.gracePeriod == 0 {
+		options.gracePeriod = defaultShutdownGracePeriod
+	}
+	if options.reattach == nil {
+		cfg, err := reattachConfigFromEnv()
+		if err != nil {
 			return nil, err
 		}
+		options.reattach = cfg
+	}
+	if options.reattach != nil {
+		return newReattachedPlugin(ctx, pkg, options.reattach)
+	}
+
+	var tlsMaterial *pluginTLSMaterial
+	if options.tls {
+		var err error
+		if tlsMaterial, err = newPluginTLSMaterial(string(pkg)); err != nil {
+			return nil, err
+		}
+	}
+
+	broker, err := newBroker(ctx, tlsMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	// Locate the plugin binary across our well-known search locations, honoring any version constraint from the
+	// workspace manifest, and verify its checksum sidecar before we go anywhere near exec'ing it.
+	disc := &PluginDiscovery{Pkg: pkg, Constraint: options.constraint}
+	srvexe, err := disc.Find()
+	if err != nil {
+		return nil, err
+	}
+
+	proc, procin, procout, procerr, err := execPlugin(srvexe, tlsMaterial, broker.Addr())
+	if err != nil {
+		return nil, err
 	}
 
-	// Now that we have a process, we expect it to write a single line to STDOUT: the port it's listening on.  We only
-	// read a byte at a time so that STDOUT contains everything after the first newline.
-	var port string
+	// Now that we have a process, we expect it to write a single handshake line to STDOUT (see handshake.go).  We
+	// only read a byte at a time so that STDOUT contains everything after the first newline, for the tracer
+	// goroutines started below.
+	var line string
 	b := make([]byte, 1)
 	for {
 		n, err := procout.Read(b)
@@ -75,27 +102,24 @@ func NewPlugin(ctx *Context, pkg tokens.Package) (*Plugin, error) {
 		if n > 0 && b[0] == '\n' {
 			break
 		}
-		port += string(b[:n])
+		line += string(b[:n])
 	}
 
-	// Parse the output line (minus the '\n') to ensure it's a numeric port.
-	if _, err = strconv.Atoi(port); err != nil {
+	hs, err := parseHandshake(line)
+	if err != nil {
 		proc.Kill()
-		return nil, errors.New(
-			fmt.Sprintf("resource provider plugin '%v' wrote a non-numeric port to stdout ('%v'): %v",
-				pkg, port, err))
+		return nil, err
 	}
 
 	// For now, we will spawn goroutines that will spew STDOUT/STDERR to the relevent diag streams.
 	// TODO: eventually we want real progress reporting, etc., which will need to be done out of band via RPC.  This
 	//     will be particularly important when we parallelize the application of the resource graph.
 	tracers := []struct {
-		r   io.Reader
-		lbl string
-		cb  func(string)
+		r  io.Reader
+		cb func(string)
 	}{
-		{procout, "stdout", func(line string) { ctx.Diag.Infof(diag.Message(line)) }},
-		{procerr, "stderr", func(line string) { ctx.Diag.Errorf(diag.Message(line)) }},
+		{procout, func(line string) { ctx.Diag.Infof(diag.Message(fmt.Sprintf("plugin[%v].stdout: %v", pkg, line))) }},
+		{procerr, func(line string) { traceStderrLine(ctx, pkg, line) }},
 	}
 	for _, trace := range tracers {
 		t := trace
@@ -106,30 +130,55 @@ func NewPlugin(ctx *Context, pkg tokens.Package) (*Plugin, error) {
 				if err != nil {
 					break
 				}
-				t.cb(fmt.Sprintf("plugin[%v].%v: %v", pkg, t.lbl, line[:len(line)-1]))
+				t.cb(line[:len(line)-1])
 			}
 		}()
 	}
 
-	// Now that we have the port, go ahead and create a gRPC client connection to it.
-	conn, err := grpc.Dial(":"+port, grpc.WithInsecure())
+	// Now that we have the negotiated address, go ahead and create a gRPC client connection to it.  If we generated
+	// TLS material above and the plugin's handshake confirms it picked up a server certificate, dial with mTLS;
+	// otherwise -- e.g. an older plugin that doesn't know to look for the TLS env vars -- fall back to insecure.
+	var dialOpt grpc.DialOption
+	if tlsMaterial != nil && hs.ServerCert != "" {
+		tlsConfig, err := tlsMaterial.clientTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	} else {
+		dialOpt = grpc.WithInsecure()
+	}
+	conn, err := grpc.Dial(hs.Addr, dialOpt)
 	if err != nil {
 		return nil, err
 	}
 	return &Plugin{
-		ctx:    ctx,
-		pkg:    pkg,
-		proc:   proc,
-		stdin:  procin,
-		stdout: procout,
-		stderr: procerr,
-		conn:   conn,
-		client: murpc.NewResourceProviderClient(conn),
+		ctx:             ctx,
+		pkg:             pkg,
+		proc:            proc,
+		stdin:           procin,
+		stdout:          procout,
+		stderr:          procerr,
+		conn:            conn,
+		client:          murpc.NewResourceProviderClient(conn),
+		ProtocolVersion: int(hs.CoreVersion),
+		Broker:          broker,
+		gracePeriod:     options.gracePeriod,
 	}, nil
 }
 
-func execPlugin(name string) (*os.Process, io.WriteCloser, io.ReadCloser, io.ReadCloser, error) {
+func execPlugin(name string, tlsMaterial *pluginTLSMaterial,
+	brokerAddr string) (*os.Process, io.WriteCloser, io.ReadCloser, io.ReadCloser, error) {
 	cmd := exec.Command(name)
+	cmd.Env = append(os.Environ(),
+		pluginMagicCookieKey+"="+pluginMagicCookieValue,
+		pluginBrokerAddrKey+"="+brokerAddr)
+	if tlsMaterial != nil {
+		cmd.Env = append(cmd.Env,
+			pluginTLSCAKey+"="+string(tlsMaterial.caPEM),
+			pluginTLSCertKey+"="+string(tlsMaterial.serverPEM),
+			pluginTLSKeyKey+"="+string(tlsMaterial.serverKeyPEM))
+	}
 	in, _ := cmd.StdinPipe()
 	out, _ := cmd.StdoutPipe()
 	err, _ := cmd.StderrPipe()
@@ -241,10 +290,57 @@ func (p *Plugin) Delete(res Resource) (error, ResourceState) {
 
 // Close tears down the underlying plugin RPC connection and process.
 func (p *Plugin) Close() error {
+	// In reattach mode, the plugin process's lifecycle belongs to the developer that launched it -- we only ever
+	// tear down our gRPC connection to it, never signal or kill it.
+	if p.reattached {
+		return p.conn.Close()
+	}
+
+	// First, ask the plugin to stop accepting new requests and return once any in-flight ones have finished.  If it
+	// acknowledges in time, it gets a chance to exit on its own; if the RPC fails or times out, we escalate to a
+	// signal and finally, if it still hasn't gone away, SIGKILL.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), p.gracePeriod)
+	shutdownErr := murpc.Shutdown(shutdownCtx, p.conn)
+	cancel()
+
 	cerr := p.conn.Close()
-	// TODO: consider a more graceful termination than just SIGKILL.
-	if err := p.proc.Kill(); err != nil {
-		return err
+	berr := p.Broker.Close()
+
+	exited := make(chan *os.ProcessState, 1)
+	go func() {
+		state, _ := p.proc.Wait()
+		exited <- state
+	}()
+
+	var state *os.ProcessState
+	if shutdownErr == nil {
+		select {
+		case state = <-exited:
+		case <-time.After(p.gracePeriod):
+		}
+	}
+
+	if state == nil {
+		if err := signalPlugin(p.proc); err != nil {
+			glog.V(7).Infof("Plugin[%v].Close: failed to signal plugin, killing it instead: %v", p.pkg, err)
+			p.proc.Kill()
+		}
+		select {
+		case state = <-exited:
+		case <-time.After(p.gracePeriod):
+			p.proc.Kill()
+			state = <-exited
+		}
+	}
+
+	if cerr != nil {
+		return cerr
+	}
+	if berr != nil {
+		return berr
+	}
+	if state != nil && !state.Success() {
+		return errors.New(fmt.Sprintf("plugin for package '%v' exited unsuccessfully: %v", p.pkg, state))
 	}
-	return cerr
+	return nil
 }
@@ -0,0 +1,68 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+
+	"github.com/marapongo/mu/pkg/tokens"
+	"github.com/marapongo/mu/sdk/go/pkg/murpc"
+)
+
+// pluginReattachEnvKey is the environment variable a developer can set -- typically by pasting in the JSON a
+// plugin printed via its ServeReattach helper -- to have NewPlugin skip launching a fresh plugin process and
+// attach to one that's already running, e.g. under a debugger.
+const pluginReattachEnvKey = "MU_PLUGIN_REATTACH_CONFIG"
+
+// ReattachConfig describes an already-running resource provider plugin to attach to instead of launching a fresh
+// one.  sdk/go/pkg/murpc.ServeReattach prints the JSON for one of these to stdout for a developer to copy into
+// MU_PLUGIN_REATTACH_CONFIG.  Reattach is always insecure: a new host process reattaching to an existing plugin
+// has no way to obtain a client certificate for that plugin's ephemeral CA, so even a plugin originally launched
+// with WithTLS is dialed without transport security once reattached to. Use it only for local iteration/debugging.
+type ReattachConfig struct {
+	Addr     string
+	Pid      int
+	Protocol string
+}
+
+// WithReattach causes NewPlugin to skip execPlugin entirely and dial an already-running plugin directly at
+// cfg.Addr.  In this mode, the external process's lifecycle belongs to the developer: Close closes only the gRPC
+// connection and never signals or kills it.
+func WithReattach(cfg ReattachConfig) PluginOption {
+	return func(opts *pluginOptions) { opts.reattach = &cfg }
+}
+
+// reattachConfigFromEnv parses MU_PLUGIN_REATTACH_CONFIG, if set, so callers that create a Plugin without
+// threading through an explicit WithReattach option still honor a developer's request to attach instead of launch.
+func reattachConfigFromEnv() (*ReattachConfig, error) {
+	raw := os.Getenv(pluginReattachEnvKey)
+	if raw == "" {
+		return nil, nil
+	}
+	var cfg ReattachConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %v: %v", pluginReattachEnvKey, err)
+	}
+	return &cfg, nil
+}
+
+// newReattachedPlugin connects to an already-running plugin described by cfg instead of spawning a new one.  The
+// dial is always insecure -- see the note on ReattachConfig for why -- regardless of whether the plugin was
+// originally started with WithTLS.
+func newReattachedPlugin(ctx *Context, pkg tokens.Package, cfg *ReattachConfig) (*Plugin, error) {
+	conn, err := grpc.Dial(cfg.Addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{
+		ctx:        ctx,
+		pkg:        pkg,
+		conn:       conn,
+		client:     murpc.NewResourceProviderClient(conn),
+		reattached: true,
+	}, nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import "time"
+
+// defaultShutdownGracePeriod is how long Close waits for a plugin to exit -- first on its own after a graceful
+// Shutdown RPC, then again after being signalled -- before giving up and sending SIGKILL.
+const defaultShutdownGracePeriod = 5 * time.Second
+
+// WithShutdownGracePeriod overrides how long Close waits for a plugin to exit at each stage of shutdown before
+// escalating, in place of the default of five seconds.
+func WithShutdownGracePeriod(d time.Duration) PluginOption {
+	return func(opts *pluginOptions) { opts.gracePeriod = d }
+}
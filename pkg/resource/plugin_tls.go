@@ -0,0 +1,174 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package resource
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Environment variables used to hand a plugin the TLS material it needs to serve mTLS-authenticated gRPC.  These
+// are set on the child's process environment alongside the magic cookie; sdk/go/pkg/murpc provides a helper that
+// reads them back out on the plugin side.
+const (
+	pluginTLSCAKey   = "MU_PLUGIN_CLIENT_CA"
+	pluginTLSCertKey = "MU_PLUGIN_SERVER_CERT"
+	pluginTLSKeyKey  = "MU_PLUGIN_SERVER_KEY"
+)
+
+// pluginTLSCertLifetime bounds how long an ephemeral CA/leaf certificate minted for a single plugin invocation
+// remains valid.  This needs to comfortably outlast any plugin session -- a single apply over a large resource
+// graph can easily run for longer than an hour -- rather than expire mid-run and fail TLS verification on
+// reconnect.
+const pluginTLSCertLifetime = 24 * time.Hour
+
+// pluginOptions holds the settings configured via PluginOption functions passed to NewPlugin.
+type pluginOptions struct {
+	tls         bool
+	gracePeriod time.Duration
+	reattach    *ReattachConfig
+	constraint  string
+}
+
+// WithVersionConstraint narrows plugin discovery to binaries whose _vX.Y.Z suffix satisfies the given semver
+// range, e.g. as recorded for this package in the workspace manifest.  Binaries with no version suffix are never
+// matched once a constraint is given.
+func WithVersionConstraint(constraint string) PluginOption {
+	return func(opts *pluginOptions) { opts.constraint = constraint }
+}
+
+// PluginOption customizes how NewPlugin launches and connects to a resource plugin.
+type PluginOption func(*pluginOptions)
+
+// WithTLS causes NewPlugin to generate an ephemeral CA, a server certificate for the plugin, and a client
+// certificate for the host, all signed by that CA.  The server certificate and key are passed to the plugin via
+// its process environment, and the host requires mTLS when dialing the plugin's gRPC endpoint.  If the plugin's
+// handshake doesn't come back with a server certificate fingerprint -- e.g. because it's an older plugin that
+// doesn't know to look for the env vars -- NewPlugin falls back to the existing insecure dial.
+func WithTLS() PluginOption {
+	return func(opts *pluginOptions) { opts.tls = true }
+}
+
+// pluginTLSMaterial is the set of ephemeral certificates generated for a single plugin invocation.
+type pluginTLSMaterial struct {
+	caPEM        []byte
+	serverPEM    []byte
+	serverKeyPEM []byte
+	clientCert   tls.Certificate
+}
+
+// newPluginTLSMaterial generates a fresh, in-memory CA and a server/client certificate pair signed by it.  The
+// certificates are only ever used for the lifetime of a single plugin process and are never persisted to disk.
+func newPluginTLSMaterial(pkg string) (*pluginTLSMaterial, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mu-plugin-ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(pluginTLSCertLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	serverPEM, serverKeyPEM, err := signPluginCert(pkg+"-server", caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	clientPEM, clientKeyPEM, err := signPluginCert(pkg+"-client", caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pluginTLSMaterial{
+		caPEM:        caPEM,
+		serverPEM:    serverPEM,
+		serverKeyPEM: serverKeyPEM,
+		clientCert:   clientCert,
+	}, nil
+}
+
+// signPluginCert mints a leaf certificate for the given common name, signed by the provided CA.
+func signPluginCert(cn string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(pluginTLSCertLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// clientTLSConfig builds the tls.Config the host uses to dial a plugin that advertised TLS support in its
+// handshake, requiring the plugin to present a certificate signed by our ephemeral CA.
+func (m *pluginTLSMaterial) clientTLSConfig() (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(m.caPEM) {
+		return nil, fmt.Errorf("failed to parse generated plugin CA certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{m.clientCert},
+		RootCAs:      pool,
+		ServerName:   "localhost",
+	}, nil
+}
+
+// brokerServerTLSConfig builds the tls.Config the host's Broker uses to serve the plugin's back-channel -- config
+// and secret resolution, progress streaming, and the like.  The host is the server on this connection, the inverse
+// of the primary ResourceProvider connection, so it presents the certificate minted above for the host (m.clientCert
+// carries both ServerAuth and ClientAuth usage) and requires the plugin to authenticate back with the server
+// certificate it was handed over its environment.
+func (m *pluginTLSMaterial) brokerServerTLSConfig() (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(m.caPEM) {
+		return nil, fmt.Errorf("failed to parse generated plugin CA certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{m.clientCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}, nil
+}
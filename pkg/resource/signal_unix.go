@@ -0,0 +1,16 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+// +build !windows
+
+package resource
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalPlugin asks a plugin process to stop by sending it SIGTERM, giving it a chance to unwind before we
+// escalate to SIGKILL.
+func signalPlugin(proc *os.Process) error {
+	return proc.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,13 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+// +build windows
+
+package resource
+
+import "os"
+
+// signalPlugin tries to send a plugin process an interrupt.  On Windows, os.Process.Signal supports only os.Kill,
+// so this always returns an error, and Close then kills the plugin at once, with no grace period after the signal.
+func signalPlugin(proc *os.Process) error {
+	return proc.Signal(os.Interrupt)
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// StartStreamRequest asks the remote side of a Broker to start serving (or start dialing) the named service under
+// a particular stream id.
+type StartStreamRequest struct {
+	Id          uint64
+	ServiceName string
+}
+
+// StartStreamResponse carries the address the caller should dial to reach the requested service.
+type StartStreamResponse struct {
+	Addr string
+}
+
+// BrokerClient is the client half of the Broker service: it lets one side ask the other to start serving a
+// service under a given stream id.
+type BrokerClient interface {
+	StartStream(ctx context.Context, req *StartStreamRequest) (*StartStreamResponse, error)
+}
+
+// BrokerServer is the server half of the Broker service.
+type BrokerServer interface {
+	StartStream(ctx context.Context, req *StartStreamRequest) (*StartStreamResponse, error)
+}
+
+// brokerClient is the default BrokerClient implementation, dialing StartStream over an existing gRPC connection.
+type brokerClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewBrokerClient creates a BrokerClient that issues StartStream calls over conn.
+func NewBrokerClient(conn *grpc.ClientConn) BrokerClient {
+	return &brokerClient{conn: conn}
+}
+
+func (c *brokerClient) StartStream(ctx context.Context, req *StartStreamRequest) (*StartStreamResponse, error) {
+	resp := new(StartStreamResponse)
+	err := grpc.Invoke(ctx, "/murpc.Broker/StartStream", req, resp, c.conn)
+	return resp, err
+}
+
+// RegisterBrokerServer registers a BrokerServer implementation against a gRPC server, so the other side of a
+// Broker can call StartStream on it.
+func RegisterBrokerServer(s *grpc.Server, srv BrokerServer) {
+	s.RegisterService(&_Broker_serviceDesc, srv)
+}
+
+var _Broker_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "murpc.Broker",
+	HandlerType: (*BrokerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartStream",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(StartStreamRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(BrokerServer).StartStream(ctx, req)
+			},
+		},
+	},
+}
+
+// Broker multiplexes additional gRPC connections over the original plugin<->host transport.  A resource plugin
+// that needs to call back into the host -- to fetch configuration/secrets, stream progress events, or resolve a
+// dependent resource's outputs -- allocates a stream id with NextId and opens it with Dial, without the host
+// needing to grow a new top-level RPC on ResourceProvider for every such use case.
+type Broker struct {
+	client BrokerClient
+	nextId uint64
+}
+
+// NewBroker wraps an existing gRPC connection back to the host -- dialed at the address the host passed to this
+// plugin via the MU_PLUGIN_BROKER_ADDR environment variable, using BrokerDialOption for the dial option -- in a
+// Broker.
+func NewBroker(conn *grpc.ClientConn) *Broker {
+	return &Broker{client: NewBrokerClient(conn)}
+}
+
+// NextId allocates a new, connection-unique stream id for use with Dial.
+func (b *Broker) NextId() uint64 {
+	return atomic.AddUint64(&b.nextId, 1)
+}
+
+// Dial asks the host to start serving the named service -- e.g. "ConfigProvider" or "LogSink" -- under id, and
+// returns a gRPC connection scoped to that stream.  If the host handed this plugin TLS material at startup, the
+// sub-connection requires the same mTLS transport as the rest of the broker; otherwise it falls back to insecure.
+func (b *Broker) Dial(id uint64, service string) (*grpc.ClientConn, error) {
+	resp, err := b.client.StartStream(context.Background(), &StartStreamRequest{Id: id, ServiceName: service})
+	if err != nil {
+		return nil, err
+	}
+	dialOpt, _, err := BrokerDialOption()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(resp.Addr, dialOpt)
+}
@@ -0,0 +1,26 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"fmt"
+	"os"
+)
+
+// Environment variable and value the host sets on every plugin child process before exec'ing it. These must match
+// pkg/resource.pluginMagicCookieKey/pluginMagicCookieValue.
+const (
+	magicCookieKey   = "MU_PLUGIN_MAGIC_COOKIE"
+	magicCookieValue = "f68ea9c6-2a1f-4e95-b9fc-17a2e1c7db5a"
+)
+
+// VerifyMagicCookie checks that this process was launched by the mu host rather than run directly by a user or
+// some other unrelated process, by comparing MU_PLUGIN_MAGIC_COOKIE against the value only the host knows to set.
+// A resource provider plugin's main should call this before doing anything else and exit if it returns an error.
+func VerifyMagicCookie() error {
+	if v := os.Getenv(magicCookieKey); v != magicCookieValue {
+		return fmt.Errorf("this binary is a mu resource provider plugin and must be launched by the mu host, " +
+			"not run directly")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Logger is a minimal hclog-style logger for resource provider plugins.  It writes one JSON object per line to
+// stderr in the format the host's plugin tracer knows how to parse and re-dispatch at the correct diag severity:
+//
+//	{"@level":"info","@message":"...","@timestamp":"...","urn":"...","err":"..."}
+//
+// Lines that aren't valid JSON are traced by the host as raw, unstructured output, so plugins are free to mix
+// Logger calls with plain fmt.Fprintln(os.Stderr, ...) during development.
+type Logger struct {
+	urn string
+}
+
+// NewLogger creates a Logger that writes structured log lines to stderr.
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+// WithURN returns a copy of the Logger that tags every line it writes with the given resource URN, so the host can
+// correlate log output surfaced from Create/Update/Delete back to the resource that produced it.
+func (l *Logger) WithURN(urn string) *Logger {
+	return &Logger{urn: urn}
+}
+
+// Debugf logs a debug-level message.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.write("debug", "", format, args...)
+}
+
+// Infof logs an info-level message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write("info", "", format, args...)
+}
+
+// Warnf logs a warn-level message.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.write("warn", "", format, args...)
+}
+
+// Errorf logs an error-level message.  If err is non-nil, its message is attached as the structured err field.
+func (l *Logger) Errorf(err error, format string, args ...interface{}) {
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	l.write("error", errStr, format, args...)
+}
+
+func (l *Logger) write(level string, errStr string, format string, args ...interface{}) {
+	line := struct {
+		Level     string `json:"@level"`
+		Message   string `json:"@message"`
+		Timestamp string `json:"@timestamp"`
+		URN       string `json:"urn,omitempty"`
+		Err       string `json:"err,omitempty"`
+	}{
+		Level:     level,
+		Message:   fmt.Sprintf(format, args...),
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		URN:       l.urn,
+		Err:       errStr,
+	}
+	enc, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(enc))
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ReattachConfig mirrors pkg/resource.ReattachConfig.  ServeReattach prints one of these as JSON to stdout in
+// place of the usual handshake line, for a developer to copy/paste into MU_PLUGIN_REATTACH_CONFIG so the engine
+// attaches to this already-running process instead of launching a fresh one.
+//
+// Reattach is insecure-only: the host dials Addr with no transport security regardless of whether this plugin was
+// originally launched with WithTLS, since the new host process has no way to obtain a client certificate signed by
+// the original session's ephemeral CA (its private key never leaves the host that generated it). Use reattach only
+// for local iteration/debugging, never in a deployed configuration that requires mTLS.
+type ReattachConfig struct {
+	Addr     string
+	Pid      int
+	Protocol string
+}
+
+// ServeReattach prints a plugin's reattach configuration to stdout, including the negotiated protocol version, so
+// a developer iterating on or debugging the provider can paste it straight into MU_PLUGIN_REATTACH_CONFIG.
+func ServeReattach(addr string, protocolVersion int) error {
+	cfg := ReattachConfig{
+		Addr:     addr,
+		Pid:      os.Getpid(),
+		Protocol: fmt.Sprintf("%v", protocolVersion),
+	}
+
+	enc, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(enc))
+	return nil
+}
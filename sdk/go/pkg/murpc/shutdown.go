@@ -0,0 +1,21 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ShutdownRequest asks a resource provider plugin to stop accepting new requests and return once any in-flight
+// ones have finished, so the host can let it exit on its own instead of resorting to a signal.
+type ShutdownRequest struct{}
+
+// ShutdownResponse is returned once a plugin has finished draining any in-flight requests.
+type ShutdownResponse struct{}
+
+// Shutdown asks the resource provider plugin on the other end of conn to begin a graceful shutdown.  It blocks
+// until the plugin acknowledges -- having drained any in-flight Create/Update/Delete calls -- or ctx is done.
+func Shutdown(ctx context.Context, conn *grpc.ClientConn) error {
+	return grpc.Invoke(ctx, "/murpc.ResourceProvider/Shutdown", &ShutdownRequest{}, &ShutdownResponse{}, conn)
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Marapongo, Inc. All rights reserved.
+
+package murpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Environment variables the host sets on a plugin's process before exec'ing it when it wants the plugin to serve
+// mTLS-authenticated gRPC.  These must match the keys used by pkg/resource.NewPlugin's WithTLS option.
+const (
+	envClientCA   = "MU_PLUGIN_CLIENT_CA"
+	envServerCert = "MU_PLUGIN_SERVER_CERT"
+	envServerKey  = "MU_PLUGIN_SERVER_KEY"
+)
+
+// ServerTLSOption reads the TLS material the host, if any, passed to this plugin via its process environment and
+// returns a grpc.ServerOption configuring mTLS.  The returned bool is false -- with a nil, non-error ServerOption --
+// if the host didn't request TLS, in which case the plugin should serve insecurely and omit the server certificate
+// field from its handshake line.
+func ServerTLSOption() (grpc.ServerOption, bool, error) {
+	caPEM := os.Getenv(envClientCA)
+	certPEM := os.Getenv(envServerCert)
+	keyPEM := os.Getenv(envServerKey)
+	if caPEM == "" || certPEM == "" || keyPEM == "" {
+		return nil, false, nil
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, false, fmt.Errorf("parsing plugin server certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, false, fmt.Errorf("parsing plugin client CA certificate")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	return grpc.Creds(credentials.NewTLS(tlsConfig)), true, nil
+}
+
+// BrokerDialOption mirrors ServerTLSOption but for connections the plugin initiates back into the host -- dialing
+// MU_PLUGIN_BROKER_ADDR itself, or Broker.Dial for an individual sub-stream -- where the roles are reversed: the
+// host is the server and the plugin is the client.  It reuses the same certificate the plugin was handed to serve
+// its own ResourceProvider connection, since that certificate carries both ServerAuth and ClientAuth usage.
+// Returns the insecure default dial option and ok=false if the host didn't request TLS.
+func BrokerDialOption() (grpc.DialOption, bool, error) {
+	caPEM := os.Getenv(envClientCA)
+	certPEM := os.Getenv(envServerCert)
+	keyPEM := os.Getenv(envServerKey)
+	if caPEM == "" || certPEM == "" || keyPEM == "" {
+		return grpc.WithInsecure(), false, nil
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, false, fmt.Errorf("parsing plugin client certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, false, fmt.Errorf("parsing plugin client CA certificate")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   "localhost",
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), true, nil
+}